@@ -0,0 +1,599 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Binary JSON type tags, as used on the wire by MySQL for JSON columns
+// (binlog row images, replicated JSON, etc). See sql/json_binary.h in the
+// MySQL source for the authoritative description of this format.
+const (
+	binSmallObject = 0x00
+	binLargeObject = 0x01
+	binSmallArray  = 0x02
+	binLargeArray  = 0x03
+	binLiteral     = 0x04
+	binInt16       = 0x05
+	binUint16      = 0x06
+	binInt32       = 0x07
+	binUint32      = 0x08
+	binInt64       = 0x09
+	binUint64      = 0x0A
+	binDouble      = 0x0B
+	binString      = 0x0C
+	binOpaque      = 0x0F
+)
+
+const (
+	binLiteralNull  = 0x00
+	binLiteralTrue  = 0x01
+	binLiteralFalse = 0x02
+)
+
+// MySQL column type tags used inside an opaque (0x0F) value to say how to
+// interpret the bytes that follow. This package only needs to distinguish
+// the handful of types it round-trips through Value; everything else
+// (DECIMAL, GEOMETRY, ...) is preserved as an opaque blob.
+const (
+	mysqlTypeDate     = 0x0A
+	mysqlTypeTime     = 0x0B
+	mysqlTypeDateTime = 0x0C
+	mysqlTypeBit      = 0x10
+	mysqlTypeBlob     = 0xFC
+)
+
+// ParseBinary decodes buf, a value in MySQL's native binary JSON format,
+// into a Value tree. This is the format JSON columns are stored in on disk
+// and replicated in, as opposed to the text form Parser.ParseBytes expects.
+//
+// buf is untrusted wire data (a binlog row image can be truncated or come
+// from a skewed MySQL version), so a decode failure is always reported as
+// an error: the decoder below bounds-checks every length it reads off the
+// wire, but not every fixed-size scalar read, and relies on this recover to
+// turn any remaining out-of-range slice into an error instead of crashing
+// the caller.
+func ParseBinary(buf []byte) (v *Value, err error) {
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("json: empty binary document")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("json: malformed binary document: %v", r)
+		}
+	}()
+	d := &binaryDecoder{doc: buf}
+	return d.decodeValueAt(buf[0], 1)
+}
+
+// binaryDecoder walks a MySQL binary JSON document. Every position it
+// tracks is an absolute offset into doc; offsets read from key/value
+// entries are relative to the start of the object or array that contains
+// them, and are resolved to an absolute position before being followed.
+type binaryDecoder struct {
+	doc []byte
+}
+
+// checkSlice reports an error if doc[pos:pos+n] isn't a valid slice of the
+// document, instead of letting the caller find out by panicking. Every
+// length that comes off the wire (a container's count, a varlen string or
+// opaque length, ...) must go through this before it's used to allocate or
+// slice, since buf is untrusted and those lengths can be arbitrarily large.
+func (d *binaryDecoder) checkSlice(pos, n int) error {
+	if pos < 0 || n < 0 || pos > len(d.doc) || n > len(d.doc)-pos {
+		return fmt.Errorf("json: binary document truncated: need %d bytes at offset %d, have %d", n, pos, len(d.doc)-pos)
+	}
+	return nil
+}
+
+func (d *binaryDecoder) decodeValueAt(typ byte, pos int) (*Value, error) {
+	switch typ {
+	case binSmallObject:
+		return d.decodeContainer(pos, false, true)
+	case binLargeObject:
+		return d.decodeContainer(pos, true, true)
+	case binSmallArray:
+		return d.decodeContainer(pos, false, false)
+	case binLargeArray:
+		return d.decodeContainer(pos, true, false)
+	case binLiteral:
+		switch d.doc[pos] {
+		case binLiteralNull:
+			return ValueNull, nil
+		case binLiteralTrue:
+			return ValueTrue, nil
+		case binLiteralFalse:
+			return ValueFalse, nil
+		default:
+			return nil, fmt.Errorf("json: invalid literal tag 0x%02x", d.doc[pos])
+		}
+	case binInt16:
+		n := int16(binary.LittleEndian.Uint16(d.doc[pos:]))
+		return &Value{t: TypeNumber, s: strconv.FormatInt(int64(n), 10)}, nil
+	case binUint16:
+		n := binary.LittleEndian.Uint16(d.doc[pos:])
+		return &Value{t: TypeNumber, s: strconv.FormatUint(uint64(n), 10)}, nil
+	case binInt32:
+		n := int32(binary.LittleEndian.Uint32(d.doc[pos:]))
+		return &Value{t: TypeNumber, s: strconv.FormatInt(int64(n), 10)}, nil
+	case binUint32:
+		n := binary.LittleEndian.Uint32(d.doc[pos:])
+		return &Value{t: TypeNumber, s: strconv.FormatUint(uint64(n), 10)}, nil
+	case binInt64:
+		n := int64(binary.LittleEndian.Uint64(d.doc[pos:]))
+		return &Value{t: TypeNumber, s: strconv.FormatInt(n, 10)}, nil
+	case binUint64:
+		n := binary.LittleEndian.Uint64(d.doc[pos:])
+		return &Value{t: TypeNumber, s: strconv.FormatUint(n, 10)}, nil
+	case binDouble:
+		f := math.Float64frombits(binary.LittleEndian.Uint64(d.doc[pos:]))
+		return &Value{t: TypeNumber, s: strconv.FormatFloat(f, 'g', -1, 64)}, nil
+	case binString:
+		n, start, err := d.readVarlen(pos)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.checkSlice(start, n); err != nil {
+			return nil, err
+		}
+		return &Value{t: TypeString, s: string(d.doc[start : start+n])}, nil
+	case binOpaque:
+		return d.decodeOpaque(pos)
+	default:
+		return nil, fmt.Errorf("json: unsupported binary type tag 0x%02x", typ)
+	}
+}
+
+// decodeContainer decodes the object or array whose header (count, total
+// size, key entries if any, value entries) begins at headerPos.
+func (d *binaryDecoder) decodeContainer(headerPos int, large, isObject bool) (*Value, error) {
+	offSize := 2
+	if large {
+		offSize = 4
+	}
+	count, err := d.readUint(headerPos, offSize)
+	if err != nil {
+		return nil, err
+	}
+	// The size field at headerPos+offSize isn't needed to decode: entry
+	// positions follow directly from count, and every offset we follow is
+	// resolved relative to headerPos. It exists on the wire so a reader
+	// can skip a container it isn't interested in.
+
+	keyEntrySize := offSize + 2
+	valEntrySize := 1 + offSize
+	pos := headerPos + 2*offSize
+
+	// count comes straight off the wire, so before trusting it to size an
+	// allocation, check that the document is actually long enough to hold
+	// that many key/value entries: every entry needs at least one byte.
+	entryAreaLen := count * valEntrySize
+	if isObject {
+		entryAreaLen += count * keyEntrySize
+	}
+	if err := d.checkSlice(pos, entryAreaLen); err != nil {
+		return nil, fmt.Errorf("json: implausible container count %d: %w", count, err)
+	}
+
+	var keyEntryPos int
+	if isObject {
+		keyEntryPos = pos
+		pos += count * keyEntrySize
+	}
+	valEntryPos := pos
+
+	if isObject {
+		kvs := make([]kv, count)
+		for i := 0; i < count; i++ {
+			ke := keyEntryPos + i*keyEntrySize
+			keyOff, err := d.readUint(ke, offSize)
+			if err != nil {
+				return nil, err
+			}
+			keyLen, err := d.readUint(ke+offSize, 2)
+			if err != nil {
+				return nil, err
+			}
+			start := headerPos + keyOff
+			if err := d.checkSlice(start, keyLen); err != nil {
+				return nil, err
+			}
+			val, err := d.decodeValueEntry(headerPos, valEntryPos+i*valEntrySize, large)
+			if err != nil {
+				return nil, err
+			}
+			kvs[i] = kv{k: string(d.doc[start : start+keyLen]), v: val}
+		}
+		return &Value{t: TypeObject, o: object{kvs: kvs}}, nil
+	}
+
+	vals := make([]*Value, count)
+	for i := 0; i < count; i++ {
+		val, err := d.decodeValueEntry(headerPos, valEntryPos+i*valEntrySize, large)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return &Value{t: TypeArray, a: vals}, nil
+}
+
+// decodeValueEntry decodes the value described by the entry at entryPos,
+// whose container (object or array) starts at containerStart. Small
+// scalars (literals, 16-bit and, for large containers, 32-bit integers)
+// are inlined directly in the entry; everything else is stored elsewhere
+// in the container and referenced by an offset relative to containerStart.
+func (d *binaryDecoder) decodeValueEntry(containerStart, entryPos int, large bool) (*Value, error) {
+	if err := d.checkSlice(entryPos, 1); err != nil {
+		return nil, err
+	}
+	typ := d.doc[entryPos]
+	valSlot := 2
+	if large {
+		valSlot = 4
+	}
+	if sz := inlineSize(typ); sz >= 0 && sz <= valSlot {
+		return d.decodeValueAt(typ, entryPos+1)
+	}
+	rel, err := d.readUint(entryPos+1, valSlot)
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeValueAt(typ, containerStart+rel)
+}
+
+func inlineSize(typ byte) int {
+	switch typ {
+	case binLiteral:
+		return 1
+	case binInt16, binUint16:
+		return 2
+	case binInt32, binUint32:
+		return 4
+	default:
+		return -1
+	}
+}
+
+func (d *binaryDecoder) readUint(pos, size int) (int, error) {
+	if err := d.checkSlice(pos, size); err != nil {
+		return 0, err
+	}
+	if size == 2 {
+		return int(binary.LittleEndian.Uint16(d.doc[pos:])), nil
+	}
+	return int(binary.LittleEndian.Uint32(d.doc[pos:])), nil
+}
+
+// readVarlen reads a MySQL packed (variable-length) integer at pos: seven
+// data bits per byte, least-significant group first, with the top bit of
+// each byte set to say "more bytes follow". It returns the decoded value
+// and the position immediately after it.
+func (d *binaryDecoder) readVarlen(pos int) (n, next int, err error) {
+	var result, shift int
+	for i := 0; i < 5; i++ {
+		if err := d.checkSlice(pos+i, 1); err != nil {
+			return 0, 0, err
+		}
+		b := d.doc[pos+i]
+		result |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, pos + i + 1, nil
+		}
+		shift += 7
+	}
+	return 0, 0, fmt.Errorf("json: variable-length integer at offset %d is too long", pos)
+}
+
+func (d *binaryDecoder) decodeOpaque(pos int) (*Value, error) {
+	if err := d.checkSlice(pos, 1); err != nil {
+		return nil, err
+	}
+	fieldType := d.doc[pos]
+	n, start, err := d.readVarlen(pos + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkSlice(start, n); err != nil {
+		return nil, err
+	}
+	data := d.doc[start : start+n]
+
+	switch fieldType {
+	case mysqlTypeDate:
+		if len(data) != 8 {
+			return nil, fmt.Errorf("json: invalid packed DATE length %d", len(data))
+		}
+		return &Value{t: TypeDate, tm: unpackDateTime(int64(binary.LittleEndian.Uint64(data)))}, nil
+	case mysqlTypeDateTime:
+		if len(data) != 8 {
+			return nil, fmt.Errorf("json: invalid packed DATETIME length %d", len(data))
+		}
+		return &Value{t: TypeDateTime, tm: unpackDateTime(int64(binary.LittleEndian.Uint64(data)))}, nil
+	case mysqlTypeTime:
+		if len(data) != 8 {
+			return nil, fmt.Errorf("json: invalid packed TIME length %d", len(data))
+		}
+		dur, overflowed := clampTimeDuration(unpackTime(int64(binary.LittleEndian.Uint64(data))))
+		if overflowed {
+			return nil, fmt.Errorf("json: packed TIME value out of range %v..%v", MinTimeDuration, MaxTimeDuration)
+		}
+		return &Value{t: TypeTime, dur: dur}, nil
+	case mysqlTypeBit:
+		return &Value{t: TypeBit, s: string(data)}, nil
+	default:
+		// BLOB and the various string/char column types, plus anything
+		// this package doesn't have a richer Value type for (e.g.
+		// DECIMAL), are preserved verbatim as an opaque blob.
+		return &Value{t: TypeBlob, s: string(data)}, nil
+	}
+}
+
+// unpackDateTime decodes the 64-bit packed representation MySQL uses for
+// DATE and DATETIME opaque values: a 40-bit year/month/day/hour/minute/
+// second field followed by a 24-bit microseconds field. DATE values use
+// the same layout with the time-of-day bits always zero.
+func unpackDateTime(packed int64) time.Time {
+	if packed < 0 {
+		packed = -packed
+	}
+	micros := packed & 0xFFFFFF
+	ymdhms := packed >> 24
+	ymd := ymdhms >> 17
+	ym := ymd >> 5
+	hms := ymdhms & 0x1FFFF
+
+	day := int(ymd & 0x1F)
+	month := int(ym % 13)
+	year := int(ym / 13)
+	second := int(hms & 0x3F)
+	minute := int((hms >> 6) & 0x3F)
+	hour := int(hms >> 12)
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, int(micros)*1000, time.UTC)
+}
+
+// packDateTime is the inverse of unpackDateTime.
+func packDateTime(t time.Time) int64 {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	ymd := (int64(year)*13+int64(month))<<5 | int64(day)
+	hms := int64(hour)<<12 | int64(minute)<<6 | int64(second)
+	micros := int64(t.Nanosecond()) / 1000
+	return (ymd<<17|hms)<<24 | micros
+}
+
+// unpackTime decodes the 64-bit packed representation MySQL uses for TIME
+// opaque values: a sign (the overall sign of packed), a 24-bit hour/
+// minute/second field (the hour component is not range-limited, unlike
+// DATETIME's) and a 24-bit microseconds field.
+func unpackTime(packed int64) time.Duration {
+	neg := packed < 0
+	if neg {
+		packed = -packed
+	}
+	micros := packed & 0xFFFFFF
+	hms := packed >> 24
+	second := hms & 0x3F
+	minute := (hms >> 6) & 0x3F
+	hour := hms >> 12
+
+	d := time.Duration(hour)*time.Hour +
+		time.Duration(minute)*time.Minute +
+		time.Duration(second)*time.Second +
+		time.Duration(micros)*time.Microsecond
+	if neg {
+		d = -d
+	}
+	return d
+}
+
+// packTime is the inverse of unpackTime.
+func packTime(d time.Duration) int64 {
+	neg := d < 0
+	if neg {
+		d = -d
+	}
+	hours := int64(d / time.Hour)
+	d -= time.Duration(hours) * time.Hour
+	minutes := int64(d / time.Minute)
+	d -= time.Duration(minutes) * time.Minute
+	seconds := int64(d / time.Second)
+	d -= time.Duration(seconds) * time.Second
+	micros := int64(d / time.Microsecond)
+
+	packed := (hours<<12|minutes<<6|seconds)<<24 | micros
+	if neg {
+		packed = -packed
+	}
+	return packed
+}
+
+// MarshalBinary encodes v into MySQL's native binary JSON format, the
+// inverse of ParseBinary. For simplicity it always emits the "large"
+// object/array form (4-byte counts and offsets); it doesn't replicate
+// MySQL's size-based choice of the more compact "small" form, which
+// ParseBinary still understands when reading values MySQL produced.
+func (v *Value) MarshalBinary() []byte {
+	typ, payload := v.encodeBinaryValue()
+	out := make([]byte, 0, 1+len(payload))
+	out = append(out, typ)
+	return append(out, payload...)
+}
+
+func (v *Value) encodeBinaryValue() (byte, []byte) {
+	switch v.t {
+	case TypeObject:
+		return binLargeObject, v.encodeBinaryObject()
+	case TypeArray:
+		return binLargeArray, v.encodeBinaryArray()
+	case TypeString, typeRawString:
+		return binString, appendPackedString(nil, v.s)
+	case TypeNumber:
+		return encodeBinaryNumber(v.s)
+	case TypeBoolean:
+		if v == ValueTrue {
+			return binLiteral, []byte{binLiteralTrue}
+		}
+		return binLiteral, []byte{binLiteralFalse}
+	case TypeNull:
+		return binLiteral, []byte{binLiteralNull}
+	case TypeDate:
+		t, _ := v.Date()
+		return binOpaque, encodeBinaryOpaque(mysqlTypeDate, packedInt64(packDateTime(t)))
+	case TypeDateTime:
+		t, _ := v.DateTime()
+		return binOpaque, encodeBinaryOpaque(mysqlTypeDateTime, packedInt64(packDateTime(t)))
+	case TypeTime:
+		dur, _ := v.Time()
+		return binOpaque, encodeBinaryOpaque(mysqlTypeTime, packedInt64(packTime(dur)))
+	case TypeBlob:
+		return binOpaque, encodeBinaryOpaque(mysqlTypeBlob, []byte(v.s))
+	case TypeBit:
+		return binOpaque, encodeBinaryOpaque(mysqlTypeBit, []byte(v.s))
+	default:
+		panic(fmt.Errorf("BUG: unexpected Value type: %d", v.t))
+	}
+}
+
+func (v *Value) encodeBinaryObject() []byte {
+	n := len(v.o.kvs)
+	const offSize = 4
+	const keyEntrySize = offSize + 2
+	const valEntrySize = 1 + offSize
+	headerLen := 2*offSize + n*keyEntrySize + n*valEntrySize
+
+	keyEntries := make([]byte, n*keyEntrySize)
+	valEntries := make([]byte, n*valEntrySize)
+	var keyData, valData []byte
+
+	for i, e := range v.o.kvs {
+		off := headerLen + len(keyData)
+		binary.LittleEndian.PutUint32(keyEntries[i*keyEntrySize:], uint32(off))
+		binary.LittleEndian.PutUint16(keyEntries[i*keyEntrySize+offSize:], uint16(len(e.k)))
+		keyData = append(keyData, e.k...)
+	}
+
+	valAreaStart := headerLen + len(keyData)
+	for i, e := range v.o.kvs {
+		typ, payload := e.v.encodeBinaryValue()
+		entry := valEntries[i*valEntrySize:]
+		entry[0] = typ
+		if inlineSize(typ) >= 0 {
+			copy(entry[1:1+len(payload)], payload)
+			continue
+		}
+		off := valAreaStart + len(valData)
+		binary.LittleEndian.PutUint32(entry[1:], uint32(off))
+		valData = append(valData, payload...)
+	}
+
+	return assembleBinaryContainer(n, headerLen, keyEntries, valEntries, keyData, valData)
+}
+
+func (v *Value) encodeBinaryArray() []byte {
+	n := len(v.a)
+	const offSize = 4
+	const valEntrySize = 1 + offSize
+	headerLen := 2*offSize + n*valEntrySize
+
+	valEntries := make([]byte, n*valEntrySize)
+	var valData []byte
+
+	for i, e := range v.a {
+		typ, payload := e.encodeBinaryValue()
+		entry := valEntries[i*valEntrySize:]
+		entry[0] = typ
+		if inlineSize(typ) >= 0 {
+			copy(entry[1:1+len(payload)], payload)
+			continue
+		}
+		off := headerLen + len(valData)
+		binary.LittleEndian.PutUint32(entry[1:], uint32(off))
+		valData = append(valData, payload...)
+	}
+
+	return assembleBinaryContainer(n, headerLen, nil, valEntries, nil, valData)
+}
+
+func assembleBinaryContainer(count, headerLen int, keyEntries, valEntries, keyData, valData []byte) []byte {
+	total := headerLen + len(keyData) + len(valData)
+	out := make([]byte, 8, total)
+	binary.LittleEndian.PutUint32(out[0:4], uint32(count))
+	binary.LittleEndian.PutUint32(out[4:8], uint32(total))
+	out = append(out, keyEntries...)
+	out = append(out, valEntries...)
+	out = append(out, keyData...)
+	out = append(out, valData...)
+	return out
+}
+
+func encodeBinaryNumber(s string) (byte, []byte) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case i >= math.MinInt16 && i <= math.MaxInt16:
+			b := make([]byte, 2)
+			binary.LittleEndian.PutUint16(b, uint16(int16(i)))
+			return binInt16, b
+		case i >= math.MinInt32 && i <= math.MaxInt32:
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, uint32(int32(i)))
+			return binInt32, b
+		default:
+			return binInt64, packedInt64(i)
+		}
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, u)
+		return binUint64, b
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	return binDouble, b
+}
+
+func packedInt64(v int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func appendPackedString(dst []byte, s string) []byte {
+	dst = appendPackedLen(dst, len(s))
+	return append(dst, s...)
+}
+
+func appendPackedLen(dst []byte, n int) []byte {
+	for n >= 0x80 {
+		dst = append(dst, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(dst, byte(n))
+}
+
+func encodeBinaryOpaque(fieldType byte, data []byte) []byte {
+	out := []byte{fieldType}
+	out = appendPackedLen(out, len(data))
+	return append(out, data...)
+}
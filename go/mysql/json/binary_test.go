@@ -0,0 +1,164 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBinaryRoundTrip confirms MarshalBinary/ParseBinary are inverses for
+// every Value shape this package round-trips, including the temporal
+// opaque subtypes.
+func TestBinaryRoundTrip(t *testing.T) {
+	loc := time.UTC
+	values := []*Value{
+		ValueTrue,
+		ValueFalse,
+		ValueNull,
+		{t: TypeNumber, s: "0"},
+		{t: TypeNumber, s: "-12345"},
+		{t: TypeNumber, s: "98765432109876"},
+		{t: TypeNumber, s: "3.14159"},
+		{t: TypeString, s: "hello, world"},
+		{t: TypeString, s: ""},
+		{t: TypeDate, tm: time.Date(2024, 1, 2, 0, 0, 0, 0, loc)},
+		{t: TypeDateTime, tm: time.Date(2024, 1, 2, 3, 4, 5, 6000, loc)},
+		{t: TypeTime, dur: 25*time.Hour + 3*time.Second},
+		{t: TypeTime, dur: -(25*time.Hour + 3*time.Second)},
+		{t: TypeBlob, s: "\x00\x01\xff binary"},
+		{t: TypeBit, s: string([]byte{0b1010, 0b1111})},
+		{t: TypeArray, a: []*Value{
+			{t: TypeNumber, s: "1"},
+			{t: TypeString, s: "two"},
+			ValueTrue,
+		}},
+		{t: TypeObject, o: object{kvs: []kv{
+			{k: "a", v: &Value{t: TypeNumber, s: "1"}},
+			{k: "nested", v: &Value{t: TypeObject, o: object{kvs: []kv{
+				{k: "b", v: &Value{t: TypeString, s: "c"}},
+			}}}},
+		}}},
+		{t: TypeObject, o: object{}},
+		{t: TypeArray, a: nil},
+	}
+
+	for _, v := range values {
+		bin := v.MarshalBinary()
+		got, err := ParseBinary(bin)
+		if err != nil {
+			t.Fatalf("ParseBinary(MarshalBinary(%+v)) failed: %v", v, err)
+		}
+		assertValuesEqual(t, v, got)
+	}
+}
+
+// assertValuesEqual compares two Values field by field; it doesn't need to
+// be exhaustive, just enough to catch a decode that silently drops or
+// mangles data.
+func assertValuesEqual(t *testing.T, want, got *Value) {
+	t.Helper()
+	if want.t != got.t {
+		t.Fatalf("type mismatch: want %v, got %v", want.t, got.t)
+	}
+	switch want.t {
+	case TypeObject:
+		if len(want.o.kvs) != len(got.o.kvs) {
+			t.Fatalf("object length mismatch: want %d, got %d", len(want.o.kvs), len(got.o.kvs))
+		}
+		for i := range want.o.kvs {
+			if want.o.kvs[i].k != got.o.kvs[i].k {
+				t.Fatalf("key %d mismatch: want %q, got %q", i, want.o.kvs[i].k, got.o.kvs[i].k)
+			}
+			assertValuesEqual(t, want.o.kvs[i].v, got.o.kvs[i].v)
+		}
+	case TypeArray:
+		if len(want.a) != len(got.a) {
+			t.Fatalf("array length mismatch: want %d, got %d", len(want.a), len(got.a))
+		}
+		for i := range want.a {
+			assertValuesEqual(t, want.a[i], got.a[i])
+		}
+	case TypeDate, TypeDateTime:
+		if !want.tm.Equal(got.tm) {
+			t.Fatalf("time mismatch: want %v, got %v", want.tm, got.tm)
+		}
+	case TypeTime:
+		if want.dur != got.dur {
+			t.Fatalf("duration mismatch: want %v, got %v", want.dur, got.dur)
+		}
+	case TypeBoolean, TypeNull:
+		// Singletons; the type check above already confirmed equality.
+	default:
+		if want.s != got.s {
+			t.Fatalf("value mismatch: want %q, got %q", want.s, got.s)
+		}
+	}
+}
+
+// TestParseBinaryMalformed feeds ParseBinary hand-crafted and truncated
+// documents that a corrupted or adversarial replication stream could
+// produce, and confirms it always returns an error rather than panicking
+// or, for a claimed container count wildly out of proportion to the
+// buffer, attempting a huge allocation.
+func TestParseBinaryMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"small object header truncated", []byte{0x00}},
+		{"small object count with no entries", []byte{0x00, 0x01, 0x00, 0x00, 0x00}},
+		{"unsupported type tag", []byte{0x0D}},
+		{"invalid literal tag", []byte{0x04, 0x03}},
+		{"string varlen truncated", []byte{0x0C, 0x80, 0x80, 0x80, 0x80, 0x80}},
+		{"opaque length truncated", []byte{0x0F, mysqlTypeDate}},
+		{"opaque data truncated", []byte{0x0F, mysqlTypeDate, 0x08}},
+		// binLargeObject header claiming ~2^31 entries, far more than 9
+		// bytes of document could ever hold.
+		{"implausible large object count", []byte{0x01, 0xFF, 0xFF, 0xFF, 0x7F, 0, 0, 0, 0}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ParseBinary(c.buf); err == nil {
+				t.Fatalf("ParseBinary(%x) = nil error, want an error", c.buf)
+			}
+		})
+	}
+}
+
+// TestParseBinaryImplausibleCountFailsFast confirms the huge-count case
+// above is rejected by the buffer-length check before any allocation is
+// attempted, rather than merely being caught later by a recovered panic:
+// a real attempt to allocate the claimed ~49 GB would make this test hang
+// or get OOM-killed instead of returning quickly.
+func TestParseBinaryImplausibleCountFailsFast(t *testing.T) {
+	buf := []byte{0x01, 0xFF, 0xFF, 0xFF, 0x7F, 0, 0, 0, 0}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ParseBinary(buf)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ParseBinary did not return promptly for an implausible container count")
+	}
+}
@@ -17,180 +17,217 @@ limitations under the License.
 package json
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"math/big"
-	"strings"
-	"time"
+	"sync"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 
 	"vitess.io/vitess/go/sqltypes"
 )
 
+// scratchPool holds reusable 4 KiB buffers used to format temporal fields
+// and hex-encode blobs while marshaling to an io.Writer, so MarshalSQLWriter
+// doesn't have to allocate one per call.
+var scratchPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
 // MarshalSQLTo appends marshaled v to dst and returns the result in
 // the form like `JSON_OBJECT` or `JSON_ARRAY` to ensure we don't
 // lose any type information.
 func (v *Value) MarshalSQLTo(dst []byte) []byte {
-	return v.marshalSQLInternal(true, dst)
+	buf := bytes.NewBuffer(dst)
+	// MarshalSQLWriter only ever fails if the underlying io.Writer does,
+	// and bytes.Buffer.Write never returns an error.
+	_ = v.MarshalSQLWriter(buf)
+	return buf.Bytes()
+}
+
+// MarshalSQLWriter writes the same SQL form that MarshalSQLTo returns
+// directly to w, without ever materializing the full result in memory.
+// This is the form vreplication and schema-copy paths should prefer for
+// wide JSON columns, where building the whole []byte up front is wasteful.
+func (v *Value) MarshalSQLWriter(w io.Writer) error {
+	scratchp := scratchPool.Get().(*[]byte)
+	defer scratchPool.Put(scratchp)
+
+	sw := &sqlWriter{w: w, scratch: (*scratchp)[:0]}
+	v.marshalSQLWriterInternal(true, sw)
+	return sw.err
+}
+
+// sqlWriter accumulates a sticky error across a sequence of writes, so the
+// tree-walking code below doesn't need to check an error after every single
+// write call: once one write fails, the rest become no-ops and the error is
+// reported once the walk unwinds.
+type sqlWriter struct {
+	w       io.Writer
+	scratch []byte
+	err     error
 }
 
-func (v *Value) marshalSQLInternal(top bool, dst []byte) []byte {
+func (sw *sqlWriter) writeString(s string) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = io.WriteString(sw.w, s)
+}
+
+func (sw *sqlWriter) writeBytes(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = sw.w.Write(b)
+}
+
+func (v *Value) marshalSQLWriterInternal(top bool, sw *sqlWriter) {
 	switch v.t {
 	case TypeObject:
-		dst = append(dst, "JSON_OBJECT("...)
+		sw.writeString("JSON_OBJECT(")
 		for i, vv := range v.o.kvs {
 			if i != 0 {
-				dst = append(dst, ", "...)
+				sw.writeString(", ")
 			}
-			dst = append(dst, "_utf8mb4'"...)
-			dst = append(dst, vv.k...)
-			dst = append(dst, "', "...)
-			dst = vv.v.marshalSQLInternal(false, dst)
+			sw.writeString("_utf8mb4")
+			sw.writeBytes(sqltypes.EncodeStringSQL(vv.k))
+			sw.writeString(", ")
+			vv.v.marshalSQLWriterInternal(false, sw)
 		}
-		dst = append(dst, ')')
-		return dst
+		sw.writeString(")")
 	case TypeArray:
-		dst = append(dst, "JSON_ARRAY("...)
+		sw.writeString("JSON_ARRAY(")
 		for i, vv := range v.a {
 			if i != 0 {
-				dst = append(dst, ", "...)
+				sw.writeString(", ")
 			}
-			dst = vv.marshalSQLInternal(false, dst)
+			vv.marshalSQLWriterInternal(false, sw)
 		}
-		dst = append(dst, ')')
-		return dst
+		sw.writeString(")")
 	case TypeString, typeRawString:
 		if top {
-			dst = append(dst, "CAST(JSON_QUOTE("...)
+			sw.writeString("CAST(JSON_QUOTE(")
 		}
-		dst = append(dst, "_utf8mb4"...)
-		dst = append(dst, sqltypes.EncodeStringSQL(v.s)...)
+		sw.writeString("_utf8mb4")
+		sw.writeBytes(sqltypes.EncodeStringSQL(v.s))
 		if top {
-			dst = append(dst, ") as JSON)"...)
+			sw.writeString(") as JSON)")
 		}
-		return dst
 	case TypeDate:
 		t, _ := v.Date()
 
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, "date '"...)
-		dst = append(dst, t.Format("2006-01-02")...)
-		dst = append(dst, "'"...)
+		sw.writeString("date '")
+		sw.scratch = formatDate(sw.scratch[:0], t)
+		sw.writeBytes(sw.scratch)
+		sw.writeString("'")
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeDateTime:
 		t, _ := v.DateTime()
+		loc, hasLoc := v.Location()
 
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, "timestamp '"...)
-		dst = append(dst, t.Format("2006-01-02 15:04:05.000000")...)
-		dst = append(dst, "'"...)
-		if top {
-			dst = append(dst, " as JSON)"...)
+		if hasLoc {
+			// MySQL has no AT TIME ZONE syntax; CONVERT_TZ is the
+			// MySQL-valid way to say "this UTC instant, viewed in loc".
+			sw.writeString("CONVERT_TZ(")
 		}
-		return dst
-	case TypeTime:
-		now := time.Now()
-		year, month, day := now.Date()
-
-		t, _ := v.Time()
-		diff := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
-		var neg bool
-		if diff < 0 {
-			diff = -diff
-			neg = true
+		sw.writeString("timestamp '")
+		sw.scratch = formatDateTime(sw.scratch[:0], t)
+		sw.writeBytes(sw.scratch)
+		sw.writeString("'")
+		if hasLoc {
+			sw.writeString(", '+00:00', '")
+			sw.writeString(loc.String())
+			sw.writeString("')")
 		}
-
-		b := strings.Builder{}
-		if neg {
-			b.WriteByte('-')
+		if top {
+			sw.writeString(" as JSON)")
 		}
-
-		hours := (diff / time.Hour)
-		diff -= hours * time.Hour
-		// For some reason MySQL wraps this around and loses data
-		// if it's more than 32 hours.
-		fmt.Fprintf(&b, "%02d", hours%32)
-		minutes := (diff / time.Minute)
-		fmt.Fprintf(&b, ":%02d", minutes)
-		diff -= minutes * time.Minute
-		seconds := (diff / time.Second)
-		fmt.Fprintf(&b, ":%02d", seconds)
-		diff -= seconds * time.Second
-		fmt.Fprintf(&b, ".%06d", diff/time.Microsecond)
+	case TypeTime:
+		// dur was fixed at parse time, so this is deterministic and
+		// doesn't depend on the wall-clock date the way diffing against
+		// time.Now() used to.
+		dur, _ := v.Time()
+		sw.scratch = formatTime(sw.scratch[:0], dur)
 
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, "time '"...)
-		dst = append(dst, b.String()...)
-		dst = append(dst, "'"...)
+		sw.writeString("time '")
+		sw.writeBytes(sw.scratch)
+		sw.writeString("'")
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeBlob:
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, "x'"...)
-		dst = append(dst, hex.EncodeToString([]byte(v.s))...)
-		dst = append(dst, "'"...)
+		sw.writeString("x'")
+		n := hex.EncodedLen(len(v.s))
+		if cap(sw.scratch) < n {
+			sw.scratch = make([]byte, n)
+		}
+		sw.scratch = sw.scratch[:n]
+		hex.Encode(sw.scratch, []byte(v.s))
+		sw.writeBytes(sw.scratch)
+		sw.writeString("'")
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeBit:
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
 		var i big.Int
 		i.SetBytes([]byte(v.s))
-		dst = append(dst, "b'"...)
-		dst = append(dst, i.Text(2)...)
-		dst = append(dst, "'"...)
+		sw.writeString("b'")
+		sw.writeString(i.Text(2))
+		sw.writeString("'")
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeNumber:
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, v.s...)
+		sw.writeString(v.s)
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeBoolean:
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
 		if v == ValueTrue {
-			dst = append(dst, "true"...)
+			sw.writeString("true")
 		} else {
-			dst = append(dst, "false"...)
+			sw.writeString("false")
 		}
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	case TypeNull:
 		if top {
-			dst = append(dst, "CAST("...)
+			sw.writeString("CAST(")
 		}
-		dst = append(dst, "null"...)
+		sw.writeString("null")
 		if top {
-			dst = append(dst, " as JSON)"...)
+			sw.writeString(" as JSON)")
 		}
-		return dst
 	default:
 		panic(fmt.Errorf("BUG: unexpected Value type: %d", v.t))
 	}
@@ -212,4 +249,4 @@ func MarshalSQLValue(buf []byte) (*sqltypes.Value, error) {
 		return nil, err
 	}
 	return &newVal, nil
-}
\ No newline at end of file
+}
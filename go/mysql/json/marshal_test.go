@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// TestMarshalSQLZonedDateTime confirms a TypeDateTime value carrying a
+// session Location marshals to the CONVERT_TZ form MySQL can actually
+// execute, and that UnmarshalSQL parses it back to the same instant and
+// zone.
+func TestMarshalSQLZonedDateTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	v := &Value{t: TypeDateTime, tm: tm, loc: loc}
+
+	sql := v.MarshalSQLTo(nil)
+	if _, err := sqlparser.ParseExpr(string(sql)); err != nil {
+		t.Fatalf("MarshalSQLTo produced unparseable SQL: %v\nsql: %s", err, sql)
+	}
+
+	got, err := UnmarshalSQL(sql)
+	if err != nil {
+		t.Fatalf("UnmarshalSQL failed: %v\nsql: %s", err, sql)
+	}
+	gotTm, err := got.DateTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotTm.Equal(tm) {
+		t.Fatalf("DateTime() = %v, want %v", gotTm, tm)
+	}
+	gotLoc, ok := got.Location()
+	if !ok || gotLoc.String() != loc.String() {
+		t.Fatalf("Location() = %v, %v, want %v, true", gotLoc, ok, loc)
+	}
+}
+
+// objectWithKey builds a single-key JSON_OBJECT Value, the shape the
+// TypeObject branch of marshalSQLWriterInternal has to escape correctly.
+func objectWithKey(key string) *Value {
+	return &Value{t: TypeObject, o: object{kvs: []kv{{k: key, v: &Value{t: TypeNumber, s: "1"}}}}}
+}
+
+// TestMarshalSQLObjectKeyEscaping exercises keys that are legal JSON but
+// would break the naive `_utf8mb4'` + key + `'` concatenation this package
+// used to do: quotes, backslashes, NULs and non-BMP codepoints must all
+// come out as well-formed, parseable SQL, and round-trip back to the
+// original key through UnmarshalSQL.
+func TestMarshalSQLObjectKeyEscaping(t *testing.T) {
+	cases := []string{
+		"plain",
+		"has'quote",
+		`has\backslash`,
+		"has'quote\\and\\backslash",
+		"has\x00nul",
+		"emoji\U0001F600key",
+		"",
+	}
+	for _, key := range cases {
+		t.Run(key, func(t *testing.T) {
+			sql := objectWithKey(key).MarshalSQLTo(nil)
+
+			if _, err := sqlparser.ParseExpr(string(sql)); err != nil {
+				t.Fatalf("MarshalSQLTo produced unparseable SQL for key %q: %v\nsql: %s", key, err, sql)
+			}
+
+			got, err := UnmarshalSQL(sql)
+			if err != nil {
+				t.Fatalf("UnmarshalSQL failed for key %q: %v\nsql: %s", key, err, sql)
+			}
+			if len(got.o.kvs) != 1 || got.o.kvs[0].k != key {
+				t.Fatalf("round-trip mismatch: got key %q, want %q", got.o.kvs[0].k, key)
+			}
+		})
+	}
+}
+
+// FuzzMarshalSQLObjectKeys checks the same property as
+// TestMarshalSQLObjectKeyEscaping over arbitrary fuzzer-generated strings,
+// including invalid UTF-8: the emitted SQL must always parse, and the key
+// must always round-trip through UnmarshalSQL.
+func FuzzMarshalSQLObjectKeys(f *testing.F) {
+	for _, seed := range []string{"plain", "has'quote", `has\backslash`, "\x00", "\U0001F600"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, key string) {
+		sql := objectWithKey(key).MarshalSQLTo(nil)
+
+		if _, err := sqlparser.ParseExpr(string(sql)); err != nil {
+			t.Fatalf("MarshalSQLTo produced unparseable SQL for key %q: %v\nsql: %s", key, err, sql)
+		}
+
+		got, err := UnmarshalSQL(sql)
+		if err != nil {
+			t.Fatalf("UnmarshalSQL failed for key %q: %v\nsql: %s", key, err, sql)
+		}
+		if got.o.kvs[0].k != key {
+			t.Fatalf("round-trip mismatch: got key %q, want %q", got.o.kvs[0].k, key)
+		}
+	})
+}
+
+// build1MiBValue builds a JSON object with enough nested rows that its
+// marshaled SQL form is roughly 1 MiB, the kind of wide JSON column value
+// vreplication streams row by row.
+func build1MiBValue() *Value {
+	const target = 1 << 20
+	var kvs []kv
+	for i, size := 0, 0; size < target; i++ {
+		row := &Value{t: TypeObject, o: object{kvs: []kv{
+			{k: "id", v: &Value{t: TypeNumber, s: strconv.Itoa(i)}},
+			{k: "name", v: &Value{t: TypeString, s: "row-" + strconv.Itoa(i)}},
+			{k: "payload", v: &Value{t: TypeString, s: "0123456789abcdef0123456789abcdef"}},
+		}}}
+		kvs = append(kvs, kv{k: strconv.Itoa(i), v: row})
+		// Each row, with its key and separator, marshals to about 150 bytes.
+		size += 150
+	}
+	return &Value{t: TypeObject, o: object{kvs: kvs}}
+}
+
+// BenchmarkMarshalSQLTo and BenchmarkMarshalSQLWriter compare the
+// []byte-building path against the io.Writer streaming path on the same
+// wide value, to show MarshalSQLWriter avoids materializing the whole
+// result in memory.
+func BenchmarkMarshalSQLTo(b *testing.B) {
+	v := build1MiBValue()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = v.MarshalSQLTo(nil)
+	}
+}
+
+func BenchmarkMarshalSQLWriter(b *testing.B) {
+	v := build1MiBValue()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := v.MarshalSQLWriter(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"strconv"
+	"time"
+)
+
+// digits10 and digits01 map a two-digit number in [0, 99] to its tens and
+// ones digit, respectively, so formatting one doesn't have to go through
+// division/modulo and fmt's general-purpose (and comparatively slow)
+// formatting machinery. This is the same trick go-sql-driver/mysql uses to
+// format DATE/DATETIME/TIME values quickly.
+var digits10 = [...]byte{
+	'0', '0', '0', '0', '0', '0', '0', '0', '0', '0',
+	'1', '1', '1', '1', '1', '1', '1', '1', '1', '1',
+	'2', '2', '2', '2', '2', '2', '2', '2', '2', '2',
+	'3', '3', '3', '3', '3', '3', '3', '3', '3', '3',
+	'4', '4', '4', '4', '4', '4', '4', '4', '4', '4',
+	'5', '5', '5', '5', '5', '5', '5', '5', '5', '5',
+	'6', '6', '6', '6', '6', '6', '6', '6', '6', '6',
+	'7', '7', '7', '7', '7', '7', '7', '7', '7', '7',
+	'8', '8', '8', '8', '8', '8', '8', '8', '8', '8',
+	'9', '9', '9', '9', '9', '9', '9', '9', '9', '9',
+}
+
+var digits01 = [...]byte{
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+	'0', '1', '2', '3', '4', '5', '6', '7', '8', '9',
+}
+
+// appendDigits2 appends the two-digit, zero-padded decimal form of v, which
+// must be in [0, 99].
+func appendDigits2(dst []byte, v int) []byte {
+	return append(dst, digits10[v], digits01[v])
+}
+
+// appendYear4 appends the four-digit, zero-padded decimal form of year,
+// which must be in [0, 9999] (the range of MySQL's YEAR component).
+func appendYear4(dst []byte, year int) []byte {
+	dst = append(dst, digits10[year/100], digits01[year/100])
+	return appendDigits2(dst, year%100)
+}
+
+// appendMicros6 appends the six-digit, zero-padded decimal form of micros,
+// which must be in [0, 999999].
+func appendMicros6(dst []byte, micros int) []byte {
+	dst = appendDigits2(dst, micros/10000)
+	dst = appendDigits2(dst, (micros/100)%100)
+	return appendDigits2(dst, micros%100)
+}
+
+// formatDate appends the `YYYY-MM-DD` form of t to dst.
+func formatDate(dst []byte, t time.Time) []byte {
+	year, month, day := t.Date()
+	dst = appendYear4(dst, year)
+	dst = append(dst, '-')
+	dst = appendDigits2(dst, int(month))
+	dst = append(dst, '-')
+	return appendDigits2(dst, day)
+}
+
+// formatDateTime appends the `YYYY-MM-DD HH:MM:SS.ffffff` form of t to dst.
+func formatDateTime(dst []byte, t time.Time) []byte {
+	dst = formatDate(dst, t)
+	dst = append(dst, ' ')
+	hour, minute, second := t.Clock()
+	dst = appendDigits2(dst, hour)
+	dst = append(dst, ':')
+	dst = appendDigits2(dst, minute)
+	dst = append(dst, ':')
+	dst = appendDigits2(dst, second)
+	dst = append(dst, '.')
+	return appendMicros6(dst, t.Nanosecond()/1000)
+}
+
+// formatTime appends the `[-]HH:MM:SS.ffffff` form of dur to dst. Unlike
+// the minutes, seconds and microsecond fields, the hour field isn't bounded
+// to two digits: MySQL's TIME type ranges up to 838:59:59, so hours of 100
+// or more fall back to strconv for that piece alone.
+func formatTime(dst []byte, dur time.Duration) []byte {
+	if dur < 0 {
+		dst = append(dst, '-')
+		dur = -dur
+	}
+	hours := dur / time.Hour
+	dur -= hours * time.Hour
+	minutes := dur / time.Minute
+	dur -= minutes * time.Minute
+	seconds := dur / time.Second
+	dur -= seconds * time.Second
+	micros := int(dur / time.Microsecond)
+
+	if hours < 100 {
+		dst = appendDigits2(dst, int(hours))
+	} else {
+		dst = strconv.AppendInt(dst, int64(hours), 10)
+	}
+	dst = append(dst, ':')
+	dst = appendDigits2(dst, int(minutes))
+	dst = append(dst, ':')
+	dst = appendDigits2(dst, int(seconds))
+	dst = append(dst, '.')
+	return appendMicros6(dst, micros)
+}
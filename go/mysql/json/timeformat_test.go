@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDateTime(t *testing.T) {
+	cases := []struct {
+		t    time.Time
+		date string
+		dt   string
+	}{
+		{time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC), "2024-01-02", "2024-01-02 03:04:05.000006"},
+		{time.Date(99, 12, 31, 23, 59, 59, 999000000, time.UTC), "0099-12-31", "0099-12-31 23:59:59.999000"},
+		{time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC), "0000-01-01", "0000-01-01 00:00:00.000000"},
+	}
+	for _, c := range cases {
+		if got := string(formatDate(nil, c.t)); got != c.date {
+			t.Errorf("formatDate(%v) = %q, want %q", c.t, got, c.date)
+		}
+		if got := string(formatDateTime(nil, c.t)); got != c.dt {
+			t.Errorf("formatDateTime(%v) = %q, want %q", c.t, got, c.dt)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	cases := []struct {
+		dur  time.Duration
+		want string
+	}{
+		{0, "00:00:00.000000"},
+		{838*time.Hour + 59*time.Minute + 59*time.Second, "838:59:59.000000"},
+		{-(838*time.Hour + 59*time.Minute + 59*time.Second), "-838:59:59.000000"},
+		{25*time.Hour + 3*time.Second + 4*time.Microsecond, "25:00:03.000004"},
+	}
+	for _, c := range cases {
+		if got := string(formatTime(nil, c.dur)); got != c.want {
+			t.Errorf("formatTime(%v) = %q, want %q", c.dur, got, c.want)
+		}
+	}
+}
+
+// benchDateTimes builds n distinct, spread-out datetimes so the benchmark
+// below doesn't just measure formatting the same value repeatedly.
+func benchDateTimes(n int) []time.Time {
+	out := make([]time.Time, n)
+	base := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range out {
+		out[i] = base.Add(time.Duration(i) * 37 * time.Second)
+	}
+	return out
+}
+
+// BenchmarkFormatDateTime exercises formatDate/formatDateTime/formatTime
+// over 10k datetime values, the hot path for a JSON column holding an
+// array of temporal values during vreplication.
+func BenchmarkFormatDateTime(b *testing.B) {
+	const n = 10000
+	times := benchDateTimes(n)
+	var scratch []byte
+
+	b.Run("formatDate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scratch = formatDate(scratch[:0], times[i%n])
+		}
+	})
+	b.Run("formatDateTime", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scratch = formatDateTime(scratch[:0], times[i%n])
+		}
+	})
+	b.Run("formatTime", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			scratch = formatTime(scratch[:0], time.Duration(i%n)*time.Second)
+		}
+	})
+}
@@ -0,0 +1,474 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// UnmarshalSQL parses buf as a SQL expression in the exact grammar that
+// MarshalSQLTo produces (nested JSON_OBJECT/JSON_ARRAY calls and typed
+// literals such as `date '...'` or `x'...'`) and reconstructs the Value it
+// was generated from, including the MySQL-specific types that a plain JSON
+// parse would otherwise lose.
+func UnmarshalSQL(buf []byte) (*Value, error) {
+	v := &Value{}
+	if err := v.UnmarshalSQLFrom(buf); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// UnmarshalSQLFrom parses buf the same way UnmarshalSQL does, overwriting v
+// with the result.
+func (v *Value) UnmarshalSQLFrom(buf []byte) error {
+	p := &sqlUnmarshaler{buf: buf}
+	p.skipSpace()
+	parsed, err := p.parseValue(true)
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return fmt.Errorf("json: unexpected trailing data at offset %d: %q", p.pos, p.peek(32))
+	}
+	*v = *parsed
+	return nil
+}
+
+// sqlUnmarshaler is a small recursive-descent parser for the SQL grammar
+// emitted by marshalSQLWriterInternal. It is intentionally narrow: it only
+// needs to understand the shapes this package produces, not arbitrary SQL.
+type sqlUnmarshaler struct {
+	buf []byte
+	pos int
+}
+
+func (p *sqlUnmarshaler) eof() bool {
+	return p.pos >= len(p.buf)
+}
+
+func (p *sqlUnmarshaler) peek(n int) []byte {
+	end := p.pos + n
+	if end > len(p.buf) {
+		end = len(p.buf)
+	}
+	return p.buf[p.pos:end]
+}
+
+func (p *sqlUnmarshaler) skipSpace() {
+	for p.pos < len(p.buf) {
+		switch p.buf[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consumeFold consumes lit from the current position, case-insensitively,
+// and reports whether it matched.
+func (p *sqlUnmarshaler) consumeFold(lit string) bool {
+	if len(p.buf)-p.pos < len(lit) {
+		return false
+	}
+	if !strings.EqualFold(string(p.buf[p.pos:p.pos+len(lit)]), lit) {
+		return false
+	}
+	p.pos += len(lit)
+	return true
+}
+
+// parseValue parses a single value. When top is true, scalars are expected
+// to be wrapped in `CAST(... as JSON)` (optionally `JSON_QUOTE(...)` for
+// strings), matching what marshalSQLWriterInternal emits at the root of the tree;
+// nested values never carry that wrapper.
+func (p *sqlUnmarshaler) parseValue(top bool) (*Value, error) {
+	p.skipSpace()
+	switch {
+	case p.consumeFold("JSON_OBJECT("):
+		return p.parseObjectBody()
+	case p.consumeFold("JSON_ARRAY("):
+		return p.parseArrayBody()
+	case top && p.consumeFold("CAST("):
+		v, err := p.parseScalar()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consumeFold("as JSON)") {
+			return nil, fmt.Errorf("json: expected \"as JSON)\" at offset %d, got %q", p.pos, p.peek(16))
+		}
+		return v, nil
+	default:
+		return p.parseScalar()
+	}
+}
+
+func (p *sqlUnmarshaler) parseObjectBody() (*Value, error) {
+	var kvs []kv
+	p.skipSpace()
+	if p.consumeFold(")") {
+		return &Value{t: TypeObject, o: object{kvs: kvs}}, nil
+	}
+	for {
+		p.skipSpace()
+		key, err := p.parseUTF8String()
+		if err != nil {
+			return nil, fmt.Errorf("json: parsing object key: %w", err)
+		}
+		p.skipSpace()
+		if !p.consumeFold(",") {
+			return nil, fmt.Errorf("json: expected ',' after object key at offset %d", p.pos)
+		}
+		val, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, kv{k: key, v: val})
+
+		p.skipSpace()
+		switch {
+		case p.consumeFold(","):
+			continue
+		case p.consumeFold(")"):
+			return &Value{t: TypeObject, o: object{kvs: kvs}}, nil
+		default:
+			return nil, fmt.Errorf("json: expected ',' or ')' in JSON_OBJECT at offset %d", p.pos)
+		}
+	}
+}
+
+func (p *sqlUnmarshaler) parseArrayBody() (*Value, error) {
+	var vals []*Value
+	p.skipSpace()
+	if p.consumeFold(")") {
+		return &Value{t: TypeArray, a: vals}, nil
+	}
+	for {
+		val, err := p.parseValue(false)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+
+		p.skipSpace()
+		switch {
+		case p.consumeFold(","):
+			continue
+		case p.consumeFold(")"):
+			return &Value{t: TypeArray, a: vals}, nil
+		default:
+			return nil, fmt.Errorf("json: expected ',' or ')' in JSON_ARRAY at offset %d", p.pos)
+		}
+	}
+}
+
+// parseScalar parses everything marshalSQLWriterInternal can emit for a non
+// object/array value, without the optional CAST(...)/JSON_QUOTE(...)
+// envelope that only appears at the top of the tree.
+func (p *sqlUnmarshaler) parseScalar() (*Value, error) {
+	p.skipSpace()
+	switch {
+	case p.consumeFold("JSON_QUOTE("):
+		s, err := p.parseUTF8String()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consumeFold(")") {
+			return nil, fmt.Errorf("json: expected ')' after JSON_QUOTE at offset %d", p.pos)
+		}
+		return &Value{t: TypeString, s: s}, nil
+	case p.consumeFold("_utf8mb4"):
+		s, err := p.parseStringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &Value{t: TypeString, s: s}, nil
+	case p.consumeFold("date '"):
+		s, err := p.scanUntilQuote()
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, fmt.Errorf("json: invalid date literal %q: %w", s, err)
+		}
+		return &Value{t: TypeDate, tm: t}, nil
+	case p.consumeFold("CONVERT_TZ("):
+		return p.parseConvertTZ()
+	case p.consumeFold("timestamp '"):
+		s, err := p.scanUntilQuote()
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("2006-01-02 15:04:05.999999", s)
+		if err != nil {
+			return nil, fmt.Errorf("json: invalid timestamp literal %q: %w", s, err)
+		}
+		return &Value{t: TypeDateTime, tm: t}, nil
+	case p.consumeFold("time '"):
+		s, err := p.scanUntilQuote()
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseTimeLiteral(s)
+		if err != nil {
+			return nil, err
+		}
+		clamped, overflowed := clampTimeDuration(d)
+		if overflowed {
+			return nil, fmt.Errorf("json: time literal %q out of range %v..%v for TIME", s, MinTimeDuration, MaxTimeDuration)
+		}
+		return &Value{t: TypeTime, dur: clamped}, nil
+	case p.consumeFold("x'"):
+		s, err := p.scanUntilQuote()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("json: invalid hex literal %q: %w", s, err)
+		}
+		return &Value{t: TypeBlob, s: string(raw)}, nil
+	case p.consumeFold("b'"):
+		s, err := p.scanUntilQuote()
+		if err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return &Value{t: TypeBit}, nil
+		}
+		var i big.Int
+		if _, ok := i.SetString(s, 2); !ok {
+			return nil, fmt.Errorf("json: invalid bit literal %q", s)
+		}
+		return &Value{t: TypeBit, s: string(i.Bytes())}, nil
+	case p.consumeFold("true"):
+		return ValueTrue, nil
+	case p.consumeFold("false"):
+		return ValueFalse, nil
+	case p.consumeFold("null"):
+		return ValueNull, nil
+	default:
+		return p.parseNumber()
+	}
+}
+
+// parseConvertTZ parses the `CONVERT_TZ(timestamp '...', '+00:00', 'zone')`
+// form marshalSQLWriterInternal emits for a TypeDateTime value that carries a
+// session Location; the opening "CONVERT_TZ(" has already been consumed.
+func (p *sqlUnmarshaler) parseConvertTZ() (*Value, error) {
+	p.skipSpace()
+	if !p.consumeFold("timestamp '") {
+		return nil, fmt.Errorf("json: expected timestamp literal at offset %d, got %q", p.pos, p.peek(16))
+	}
+	s, err := p.scanUntilQuote()
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse("2006-01-02 15:04:05.999999", s)
+	if err != nil {
+		return nil, fmt.Errorf("json: invalid timestamp literal %q: %w", s, err)
+	}
+
+	p.skipSpace()
+	if !p.consumeFold(",") {
+		return nil, fmt.Errorf("json: expected ',' in CONVERT_TZ at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if !p.consumeFold("'+00:00'") {
+		return nil, fmt.Errorf("json: expected '+00:00' source time zone at offset %d, got %q", p.pos, p.peek(16))
+	}
+	p.skipSpace()
+	if !p.consumeFold(",") {
+		return nil, fmt.Errorf("json: expected ',' in CONVERT_TZ at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if !p.consumeFold("'") {
+		return nil, fmt.Errorf("json: expected time zone literal at offset %d, got %q", p.pos, p.peek(16))
+	}
+	zone, err := p.scanUntilQuote()
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("json: invalid time zone %q: %w", zone, err)
+	}
+
+	p.skipSpace()
+	if !p.consumeFold(")") {
+		return nil, fmt.Errorf("json: expected ')' after CONVERT_TZ at offset %d", p.pos)
+	}
+	return &Value{t: TypeDateTime, tm: t, loc: loc}, nil
+}
+
+// parseTimeLiteral parses the `[-]HH:MM:SS.ffffff` form emitted for
+// TypeTime into a signed duration. The fractional part is required, and is
+// read as a whole number of microseconds, matching the six digits
+// formatTime always writes.
+func parseTimeLiteral(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var hours, minutes, seconds, micros int
+	_, err := fmt.Sscanf(s, "%d:%d:%d.%d", &hours, &minutes, &seconds, &micros)
+	if err != nil {
+		return 0, fmt.Errorf("json: invalid time literal %q: %w", s, err)
+	}
+	d := time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(micros)*time.Microsecond
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseStringLiteral parses a single-quoted SQL string literal at the
+// current position (the opening quote must be next), decoding backslash
+// escapes and doubled quotes.
+func (p *sqlUnmarshaler) parseStringLiteral() (string, error) {
+	p.skipSpace()
+	if p.eof() || p.buf[p.pos] != '\'' {
+		return "", fmt.Errorf("json: expected string literal at offset %d, got %q", p.pos, p.peek(16))
+	}
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("json: unterminated string literal")
+		}
+		c := p.buf[p.pos]
+		switch c {
+		case '\'':
+			if p.pos+1 < len(p.buf) && p.buf[p.pos+1] == '\'' {
+				b.WriteByte('\'')
+				p.pos += 2
+				continue
+			}
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", fmt.Errorf("json: unterminated escape in string literal")
+			}
+			b.WriteByte(unescapeSQL(p.buf[p.pos]))
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseUTF8String parses the `_utf8mb4'...'` form, which is what
+// JSON_QUOTE() is always called with in this package's output.
+func (p *sqlUnmarshaler) parseUTF8String() (string, error) {
+	p.skipSpace()
+	if !p.consumeFold("_utf8mb4") {
+		return "", fmt.Errorf("json: expected _utf8mb4 string at offset %d", p.pos)
+	}
+	return p.parseStringLiteral()
+}
+
+func unescapeSQL(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 26
+	default:
+		return c
+	}
+}
+
+// scanUntilQuote scans up to (and consumes) the next `'`, returning
+// everything before it; backslashes are not treated as escapes. It's used
+// for the literal bodies (dates, times, hex and binary digits, time zone
+// names) that this package never escapes when it writes them out.
+func (p *sqlUnmarshaler) scanUntilQuote() (string, error) {
+	start := p.pos
+	for p.pos < len(p.buf) {
+		if p.buf[p.pos] == '\'' {
+			s := string(p.buf[start:p.pos])
+			p.pos++
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("json: unterminated literal starting at offset %d", start)
+}
+
+func (p *sqlUnmarshaler) parseNumber() (*Value, error) {
+	start := p.pos
+	if !p.eof() && (p.buf[p.pos] == '-' || p.buf[p.pos] == '+') {
+		p.pos++
+	}
+	sawDigit := false
+	for !p.eof() && isDigit(p.buf[p.pos]) {
+		p.pos++
+		sawDigit = true
+	}
+	if !p.eof() && p.buf[p.pos] == '.' {
+		p.pos++
+		for !p.eof() && isDigit(p.buf[p.pos]) {
+			p.pos++
+			sawDigit = true
+		}
+	}
+	if !sawDigit {
+		return nil, fmt.Errorf("json: unrecognized SQL value at offset %d: %q", start, p.peek(32))
+	}
+	if !p.eof() && (p.buf[p.pos] == 'e' || p.buf[p.pos] == 'E') {
+		save := p.pos
+		p.pos++
+		if !p.eof() && (p.buf[p.pos] == '-' || p.buf[p.pos] == '+') {
+			p.pos++
+		}
+		expDigits := false
+		for !p.eof() && isDigit(p.buf[p.pos]) {
+			p.pos++
+			expDigits = true
+		}
+		if !expDigits {
+			p.pos = save
+		}
+	}
+	return &Value{t: TypeNumber, s: string(p.buf[start:p.pos])}, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package json
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type identifies the kind of a parsed JSON Value. Besides the standard
+// JSON kinds, it also carries the MySQL-specific variants that can appear
+// inside a JSON column (TypeDate, TypeDateTime, TypeTime, TypeBlob,
+// TypeBit) so that round-tripping a Value through MarshalSQLTo and back
+// doesn't lose the extra type information MySQL attaches to it.
+type Type uint16
+
+const (
+	TypeObject Type = iota
+	TypeArray
+	TypeString
+	// typeRawString is an internal variant of TypeString. MarshalSQLTo,
+	// MarshalSQLWriter and MarshalBinary quote and escape its s exactly as
+	// they do for TypeString.
+	typeRawString
+	TypeNumber
+	TypeBoolean
+	TypeNull
+	TypeDate
+	TypeDateTime
+	TypeTime
+	TypeBlob
+	TypeBit
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeObject:
+		return "OBJECT"
+	case TypeArray:
+		return "ARRAY"
+	case TypeString, typeRawString:
+		return "STRING"
+	case TypeNumber:
+		return "NUMBER"
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeNull:
+		return "NULL"
+	case TypeDate:
+		return "DATE"
+	case TypeDateTime:
+		return "DATETIME"
+	case TypeTime:
+		return "TIME"
+	case TypeBlob:
+		return "BLOB"
+	case TypeBit:
+		return "BIT"
+	default:
+		return fmt.Sprintf("Type(%d)", uint16(t))
+	}
+}
+
+// MinTimeDuration and MaxTimeDuration are the bounds of MySQL's TIME type:
+// -838:59:59 .. 838:59:59.
+const (
+	MaxTimeDuration = 838*time.Hour + 59*time.Minute + 59*time.Second
+	MinTimeDuration = -MaxTimeDuration
+)
+
+// Value is a single parsed JSON value. It is a tree: TypeObject and
+// TypeArray values hold child Values, everything else is a leaf.
+type Value struct {
+	t Type
+	s string
+	o object
+	a []*Value
+
+	// tm holds the literal moment for TypeDate and TypeDateTime. For
+	// TypeDateTime, loc additionally records the session time zone the
+	// value was read in, if any was known; tm itself is always kept in
+	// UTC so formatting doesn't depend on the process's local zone.
+	tm  time.Time
+	loc *time.Location
+
+	// dur holds the signed TIME interval for TypeTime, set once at parse
+	// time. MySQL TIME columns are intervals, not times of day — they
+	// range from -838:59:59 to 838:59:59 — so unlike tm above, a
+	// time.Time can't represent one without ambiguity once it overflows a
+	// calendar day.
+	dur time.Duration
+}
+
+type object struct {
+	kvs []kv
+}
+
+type kv struct {
+	k string
+	v *Value
+}
+
+// Singleton values for the JSON literals that carry no payload of their
+// own, mirroring how the parser hands them out.
+var (
+	ValueTrue  = &Value{t: TypeBoolean, s: "true"}
+	ValueFalse = &Value{t: TypeBoolean, s: "false"}
+	ValueNull  = &Value{t: TypeNull}
+)
+
+// Date returns the calendar date stored in a TypeDate value.
+func (v *Value) Date() (time.Time, error) {
+	if v.t != TypeDate {
+		return time.Time{}, fmt.Errorf("json: Date called on a %v value", v.t)
+	}
+	return v.tm, nil
+}
+
+// DateTime returns the moment stored in a TypeDateTime value.
+func (v *Value) DateTime() (time.Time, error) {
+	if v.t != TypeDateTime {
+		return time.Time{}, fmt.Errorf("json: DateTime called on a %v value", v.t)
+	}
+	return v.tm, nil
+}
+
+// Location returns the session time zone a TypeDateTime value was read in,
+// if one is known. This is only ever populated for values that came from a
+// TIMESTAMP column (which is stored in UTC and converted on read); plain
+// DATETIME values have no zone and Location reports ok == false.
+func (v *Value) Location() (loc *time.Location, ok bool) {
+	return v.loc, v.loc != nil
+}
+
+// Time returns the signed TIME interval stored in a TypeTime value, in the
+// range [MinTimeDuration, MaxTimeDuration].
+func (v *Value) Time() (time.Duration, error) {
+	if v.t != TypeTime {
+		return 0, fmt.Errorf("json: Time called on a %v value", v.t)
+	}
+	return v.dur, nil
+}
+
+// clampTimeDuration clamps d to the range MySQL's TIME type can represent,
+// reporting whether clamping was necessary.
+func clampTimeDuration(d time.Duration) (time.Duration, bool) {
+	switch {
+	case d > MaxTimeDuration:
+		return MaxTimeDuration, true
+	case d < MinTimeDuration:
+		return MinTimeDuration, true
+	default:
+		return d, false
+	}
+}